@@ -0,0 +1,196 @@
+package kapacitor
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// defaultEdgeBufferSize is the default capacity of the channel backing
+// an Edge between two nodes.
+const defaultEdgeBufferSize = 100
+
+// defaultRetryBufferSize bounds how many in-flight points Pause will
+// hold on to while the downstream node is restarting. Points beyond this
+// bound are dropped, oldest first, rather than growing unbounded.
+const defaultRetryBufferSize = 1000
+
+// Edge passes points of edgeType from parentName to childName within
+// taskName. A supervised node Pauses its parent edges rather than
+// Aborting them across a restart, so points already in flight are
+// drained into a bounded retry buffer instead of being lost or blocking
+// the upstream node; Resume replays them in order once the node is back
+// up.
+type Edge struct {
+	taskName, parentName, childName string
+	edgeType                        pipeline.EdgeType
+
+	logger StructuredLogger
+
+	mu      sync.Mutex
+	points  chan interface{}
+	closed  bool
+	aborted bool
+
+	paused      bool
+	retryBuffer []interface{}
+
+	collected int64
+	emitted   int64
+}
+
+// newEdge creates an Edge of edgeType between parentName and childName
+// within taskName, with a channel of the given buffer size.
+func newEdge(taskName, parentName, childName string, edgeType pipeline.EdgeType, bufferSize int, l *LogService) *Edge {
+	e := &Edge{
+		taskName:   taskName,
+		parentName: parentName,
+		childName:  childName,
+		edgeType:   edgeType,
+		points:     make(chan interface{}, bufferSize),
+	}
+	if l != nil {
+		e.logger = l.NewStructuredLogger().With(
+			Field{"task", taskName},
+			Field{"parent", parentName},
+			Field{"child", childName},
+		)
+	}
+	return e
+}
+
+// Emit sends p downstream, or buffers it if the edge is currently
+// paused. It reports false once the edge has been closed or aborted.
+func (e *Edge) Emit(p interface{}) bool {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return false
+	}
+	if e.paused {
+		e.bufferLocked(p)
+		e.mu.Unlock()
+		return true
+	}
+	e.mu.Unlock()
+
+	e.points <- p
+	atomic.AddInt64(&e.emitted, 1)
+	return true
+}
+
+// Next blocks for the next point, returning ok=false once the edge has
+// been closed and fully drained.
+func (e *Edge) Next() (p interface{}, ok bool) {
+	p, ok = <-e.points
+	if ok {
+		atomic.AddInt64(&e.collected, 1)
+	}
+	return
+}
+
+// Close closes the edge once all outstanding points have been consumed.
+func (e *Edge) Close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.closed = true
+	close(e.points)
+}
+
+// Abort closes the edge immediately, discarding any buffered points;
+// Next will return ok=false as soon as the channel is drained.
+func (e *Edge) Abort() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return
+	}
+	e.closed = true
+	e.aborted = true
+	e.retryBuffer = nil
+	close(e.points)
+	if e.logger != nil {
+		e.logger.Warn("edge aborted")
+	}
+}
+
+// Pause stops the edge from forwarding points to the channel and drains
+// anything already queued there into a bounded retry buffer, so a
+// supervised node that is restarting doesn't consume stale points nor
+// block the node upstream of it.
+func (e *Edge) Pause() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.paused || e.closed {
+		return
+	}
+	e.paused = true
+	for {
+		select {
+		case p, ok := <-e.points:
+			if !ok {
+				return
+			}
+			e.bufferLocked(p)
+		default:
+			if e.logger != nil && len(e.retryBuffer) > 0 {
+				e.logger.Debug("edge paused", Field{"buffered", len(e.retryBuffer)})
+			}
+			return
+		}
+	}
+}
+
+// Resume replays any buffered points and resumes normal forwarding. If
+// the channel fills up while replaying, the remaining points stay
+// buffered for the next Resume rather than blocking the caller.
+func (e *Edge) Resume() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.paused {
+		return
+	}
+	e.paused = false
+	i := 0
+	for ; i < len(e.retryBuffer); i++ {
+		select {
+		case e.points <- e.retryBuffer[i]:
+			atomic.AddInt64(&e.emitted, 1)
+		default:
+			e.paused = true
+			e.retryBuffer = e.retryBuffer[i:]
+			if e.logger != nil {
+				e.logger.Warn("edge resume: downstream still full, re-pausing",
+					Field{"buffered", len(e.retryBuffer)},
+				)
+			}
+			return
+		}
+	}
+	if i > 0 && e.logger != nil {
+		e.logger.Debug("edge resumed", Field{"replayed", i})
+	}
+	e.retryBuffer = nil
+}
+
+// bufferLocked appends p to the retry buffer, dropping the oldest
+// buffered point once defaultRetryBufferSize is exceeded. Callers must
+// hold e.mu.
+func (e *Edge) bufferLocked(p interface{}) {
+	e.retryBuffer = append(e.retryBuffer, p)
+	if over := len(e.retryBuffer) - defaultRetryBufferSize; over > 0 {
+		e.retryBuffer = e.retryBuffer[over:]
+	}
+}
+
+func (e *Edge) emittedCount() int64 {
+	return atomic.LoadInt64(&e.emitted)
+}
+
+func (e *Edge) collectedCount() int64 {
+	return atomic.LoadInt64(&e.collected)
+}
@@ -0,0 +1,86 @@
+package kapacitor
+
+import "testing"
+
+func TestEdgePauseDrainsOutstandingPoints(t *testing.T) {
+	e := newEdge("task", "parent", "child", 0, 4, nil)
+
+	for i := 0; i < 3; i++ {
+		if !e.Emit(i) {
+			t.Fatalf("Emit(%d) = false before pause", i)
+		}
+	}
+
+	e.Pause()
+
+	// Draining takes the points off the channel; Emit while paused goes
+	// straight into the retry buffer instead of blocking on a full
+	// channel or being delivered to a node that's mid-restart.
+	if !e.Emit(3) {
+		t.Fatal("Emit while paused reported false")
+	}
+	if got := len(e.retryBuffer); got != 4 {
+		t.Fatalf("len(retryBuffer) = %d, want 4", got)
+	}
+
+	select {
+	case <-e.points:
+		t.Fatal("channel still had a point after Pause drained it")
+	default:
+	}
+
+	e.Resume()
+
+	for i := 0; i < 4; i++ {
+		p, ok := e.Next()
+		if !ok {
+			t.Fatalf("Next() ok = false at i=%d", i)
+		}
+		if p.(int) != i {
+			t.Fatalf("Next() = %v, want %d", p, i)
+		}
+	}
+}
+
+func TestEdgePauseBuffersAreBounded(t *testing.T) {
+	e := newEdge("task", "parent", "child", 0, defaultRetryBufferSize*2, nil)
+	e.Pause()
+
+	for i := 0; i < defaultRetryBufferSize+10; i++ {
+		e.Emit(i)
+	}
+
+	if got := len(e.retryBuffer); got != defaultRetryBufferSize {
+		t.Fatalf("len(retryBuffer) = %d, want %d", got, defaultRetryBufferSize)
+	}
+	// Oldest entries should have been dropped, so the buffer should now
+	// start at index 10, not 0.
+	if got := e.retryBuffer[0].(int); got != 10 {
+		t.Fatalf("retryBuffer[0] = %d, want 10 (the oldest 10 should have been dropped)", got)
+	}
+}
+
+func TestEdgeAbortClosesAndStopsAcceptingPoints(t *testing.T) {
+	e := newEdge("task", "parent", "child", 0, 1, nil)
+	e.Abort()
+
+	if e.Emit(1) {
+		t.Fatal("Emit after Abort reported true")
+	}
+	if _, ok := e.Next(); ok {
+		t.Fatal("Next after Abort on an empty edge reported ok = true")
+	}
+}
+
+func TestEdgeEmittedAndCollectedCounts(t *testing.T) {
+	e := newEdge("task", "parent", "child", 0, 2, nil)
+	e.Emit("a")
+	e.Emit("b")
+	if got := e.emittedCount(); got != 2 {
+		t.Fatalf("emittedCount() = %d, want 2", got)
+	}
+	e.Next()
+	if got := e.collectedCount(); got != 1 {
+		t.Fatalf("collectedCount() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,25 @@
+package kapacitor
+
+import "net/http"
+
+// HTTPDService is the HTTP surface the task executor runs on: a single
+// mux every service, including the Prometheus /metrics and pprof
+// handlers, registers its routes on.
+type HTTPDService struct {
+	Mux *http.ServeMux
+}
+
+// NewHTTPDService creates the service and immediately exposes /metrics
+// and the runtime pprof handlers on it, so operators can scrape node
+// stats and pull a CPU profile from the same process without any extra
+// configuration.
+func NewHTTPDService() *HTTPDService {
+	s := &HTTPDService{Mux: http.NewServeMux()}
+	HandleMetrics(s.Mux)
+	return s
+}
+
+// ListenAndServe starts the HTTP service on addr.
+func (s *HTTPDService) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, s.Mux)
+}
@@ -0,0 +1,27 @@
+package kapacitor
+
+import (
+	"io"
+	"log"
+)
+
+// LogService is the process-wide logging sink every node and edge pulls
+// its logger from. NewLogger keeps returning a raw *log.Logger for
+// existing call sites; NewStructuredLogger (added alongside it) is the
+// field-aware logger new code should prefer.
+type LogService struct {
+	out io.Writer
+}
+
+// NewLogService returns a LogService that writes every logger it hands
+// out to w.
+func NewLogService(w io.Writer) *LogService {
+	return &LogService{out: w}
+}
+
+// NewLogger returns a standard library logger writing to the service's
+// sink, exactly as node loggers were constructed before structured
+// logging existed.
+func (l *LogService) NewLogger(prefix string, flag int) *log.Logger {
+	return log.New(l.out, prefix, flag)
+}
@@ -0,0 +1,129 @@
+package kapacitor
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestStructuredLoggerWritesTextWhenJSONDisabled(t *testing.T) {
+	var buf bytes.Buffer
+	// A bytes.Buffer is not a TTY, so NewStructuredLogger picks JSON;
+	// switch to the text encoding explicitly to test it.
+	l := NewStructuredLogger(&buf).(*structuredLogger)
+	l.json = false
+
+	l.Info("node started", Field{"task", "t1"})
+
+	got := buf.String()
+	if !strings.HasPrefix(got, "I! node started") {
+		t.Fatalf("text log line = %q, want I! prefix and message", got)
+	}
+	if !strings.Contains(got, "task=t1") {
+		t.Fatalf("text log line = %q, want it to contain task=t1", got)
+	}
+}
+
+func TestStructuredLoggerWritesJSONFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStructuredLogger(&buf).(*structuredLogger)
+	l.json = true
+
+	l.Error("snapshot failed", Field{"error", "boom"})
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %s (%q)", err, buf.String())
+	}
+	if entry["level"] != "error" {
+		t.Fatalf("entry[level] = %v, want error", entry["level"])
+	}
+	if entry["msg"] != "snapshot failed" {
+		t.Fatalf("entry[msg] = %v, want %q", entry["msg"], "snapshot failed")
+	}
+	if entry["error"] != "boom" {
+		t.Fatalf("entry[error] = %v, want boom", entry["error"])
+	}
+}
+
+func TestStructuredLoggerWithMergesFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := NewStructuredLogger(&buf)
+	base.(*structuredLogger).json = false // text encoding, so key=value is checkable
+	child := base.With(Field{"task", "t1"}, Field{"node", "n1"})
+
+	child.Warn("restarting", Field{"attempt", 2})
+
+	got := buf.String()
+	for _, want := range []string{"task=t1", "node=n1", "attempt=2"} {
+		if !strings.Contains(got, want) {
+			t.Fatalf("log line = %q, want it to contain %q", got, want)
+		}
+	}
+}
+
+func TestStructuredLoggerWithDoesNotMutateParentFields(t *testing.T) {
+	var buf bytes.Buffer
+	base := NewStructuredLogger(&buf)
+	base.(*structuredLogger).json = false // text encoding, so key=value is checkable
+	_ = base.With(Field{"task", "t1"})
+
+	buf.Reset()
+	base.Info("unscoped")
+	if strings.Contains(buf.String(), "task=t1") {
+		t.Fatalf("base logger picked up a field from a child With(): %q", buf.String())
+	}
+}
+
+func TestLogServiceNewStructuredLoggerWritesToServiceSink(t *testing.T) {
+	var buf bytes.Buffer
+	svc := NewLogService(&buf)
+
+	svc.NewStructuredLogger().Info("hello")
+
+	if !strings.Contains(buf.String(), "hello") {
+		t.Fatalf("LogService.NewStructuredLogger did not write to the service's sink: %q", buf.String())
+	}
+}
+
+func TestNewEdgeLoggerCarriesIdentityAsFields(t *testing.T) {
+	var buf bytes.Buffer
+	svc := NewLogService(&buf)
+
+	e := newEdge("taskA", "parentNode", "childNode", 0, 1, svc)
+	e.Abort() // the only edge method that unconditionally logs
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log line is not valid JSON: %s (%q)", err, buf.String())
+	}
+	for key, want := range map[string]string{"task": "taskA", "parent": "parentNode", "child": "childNode"} {
+		if entry[key] != want {
+			t.Fatalf("entry[%q] = %v, want %q", key, entry[key], want)
+		}
+	}
+}
+
+func TestEdgePauseLogsDebugWhenBufferingPoints(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStructuredLogger(&buf).(*structuredLogger)
+	l.json = true
+
+	e := newEdge("task", "parent", "child", 0, 4, nil)
+	e.logger = l
+
+	e.Emit(1)
+	e.Pause()
+	e.Emit(2) // buffered while paused
+
+	if !strings.Contains(buf.String(), "edge paused") {
+		t.Fatalf("Pause did not log through the node's structured logger: %q", buf.String())
+	}
+
+	buf.Reset()
+	e.Resume()
+	if !strings.Contains(buf.String(), "edge resumed") {
+		t.Fatalf("Resume did not log through the node's structured logger: %q", buf.String())
+	}
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"expvar"
 	"fmt"
-	"log"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -14,10 +13,12 @@ import (
 	"github.com/influxdata/kapacitor/models"
 	"github.com/influxdata/kapacitor/pipeline"
 	"github.com/influxdata/kapacitor/timer"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
 	statAverageExecTime = "avg_exec_time"
+	statRestartCount    = "restarts"
 )
 
 // A node that can be  in an executor.
@@ -30,7 +31,12 @@ type Node interface {
 	start(snapshot []byte)
 	stop()
 
-	// snapshot running state
+	// snapshot running state. The executor only ever calls snapshot
+	// while every parent edge is paused (see node.pauseIns), so
+	// implementations that embed *node and override snapshot may rely
+	// on runF being blocked in Edge.Next, rather than concurrently
+	// mutating whatever state snapshot reads, for the duration of the
+	// call.
 	snapshot() ([]byte, error)
 	restore(snapshot []byte) error
 
@@ -57,22 +63,30 @@ type Node interface {
 //implementation of Node
 type node struct {
 	pipeline.Node
-	et         *ExecutingTask
-	parents    []Node
-	children   []Node
-	runF       func(snapshot []byte) error
-	stopF      func()
-	errCh      chan error
-	err        error
-	finishedMu sync.Mutex
-	finished   bool
-	ins        []*Edge
-	outs       []*Edge
-	logger     *log.Logger
-	timer      timer.Timer
-	statsKey   string
-	statMap    *kexpvar.Map
-	avgExecVar *MaxDuration
+	et            *ExecutingTask
+	parents       []Node
+	children      []Node
+	runF          func(snapshot []byte) error
+	stopF         func()
+	snapshotF     func() ([]byte, error)
+	errCh         chan error
+	err           error
+	finishedMu    sync.Mutex
+	finished      bool
+	ins           []*Edge
+	outs          []*Edge
+	logger        StructuredLogger
+	timer         timer.Timer
+	statsKey      string
+	statMap       *kexpvar.Map
+	execTimeVar   *execTimeStat
+	promLabels    prometheus.Labels
+	lastCollected int64
+	restartCount  int64
+	lastRestart   time.Time
+
+	snapshotStore  SnapshotStore
+	stopCheckpoint chan struct{}
 }
 
 func (n *node) addParentEdge(e *Edge) {
@@ -85,6 +99,27 @@ func (n *node) abortParentEdges() {
 	}
 }
 
+// pauseIns pauses every parent edge. A paused edge stops handing points
+// to Next, so runF -- which spends its idle time blocked in a call to
+// Edge.Next rather than mutating the node's internal state -- is
+// guaranteed not to be touching that state once every parent is paused.
+// saveSnapshot uses this as its synchronization point with the goroutine
+// executing runF; supervise uses it for the same reason before
+// re-snapshotting ahead of a restart.
+func (n *node) pauseIns() {
+	for _, in := range n.ins {
+		in.Pause()
+	}
+}
+
+// resumeIns undoes pauseIns once it is safe to let runF observe new
+// points again.
+func (n *node) resumeIns() {
+	for _, in := range n.ins {
+		in.Resume()
+	}
+}
+
 func (n *node) start(snapshot []byte) {
 	tags := map[string]string{
 		"task": n.et.Task.Name,
@@ -92,44 +127,204 @@ func (n *node) start(snapshot []byte) {
 		"type": n.et.Task.Type.String(),
 		"kind": n.Desc(),
 	}
+	n.logger = n.et.tm.LogService.NewStructuredLogger().With(
+		Field{"task", tags["task"]},
+		Field{"node", tags["node"]},
+		Field{"type", tags["type"]},
+		Field{"kind", tags["kind"]},
+		Field{"trace_id", nextTraceID()},
+	)
+
 	n.statsKey, n.statMap = NewStatistics("nodes", tags)
-	n.avgExecVar = &MaxDuration{}
-	n.statMap.Set(statAverageExecTime, n.avgExecVar)
-	n.timer = n.et.tm.TimingService.NewTimer(n.avgExecVar)
+	n.promLabels = prometheus.Labels{
+		"task": tags["task"],
+		"node": tags["node"],
+		"type": tags["type"],
+		"kind": tags["kind"],
+	}
+	n.execTimeVar = &execTimeStat{
+		histogram: nodeExecTimeHistogram(n.promLabels, n.et.Task.HistogramBuckets),
+	}
+	n.statMap.Set(statAverageExecTime, n.execTimeVar)
+	n.timer = n.et.tm.TimingService.NewTimer(n.execTimeVar)
+	n.snapshotStore = n.et.tm.SnapshotService
+	if len(snapshot) == 0 && n.snapshotStore != nil {
+		if s, err := n.snapshotStore.Load(n.et.Task.Name, n.Name()); err != nil {
+			n.logger.Error("loading snapshot", Field{"error", err})
+		} else {
+			snapshot = s
+		}
+	}
+
+	if interval := n.checkpointInterval(); interval > 0 && n.snapshotStore != nil {
+		n.stopCheckpoint = make(chan struct{})
+		go n.checkpoint(interval)
+	}
+
 	n.errCh = make(chan error, 1)
-	go func() {
-		var err error
-		defer func() {
-			// Always close children edges
-			n.closeChildEdges()
-			// Propogate error up
-			if err != nil {
-				// Handle panic in runF
-				r := recover()
-				if r != nil {
-					trace := make([]byte, 512)
-					n := runtime.Stack(trace, false)
-					err = fmt.Errorf("%s: Trace:%s", r, string(trace[:n]))
-				}
-				n.abortParentEdges()
-				n.logger.Println("E!", err)
-			}
+	go n.supervise(snapshot)
+}
+
+// checkpointInterval returns how often checkpoint should snapshot this
+// node, as configured on the underlying pipeline.Node. Nodes that were
+// never configured with an interval are not checkpointed.
+func (n *node) checkpointInterval() time.Duration {
+	if p, ok := n.Node.(snapshotIntervalProvider); ok {
+		return p.SnapshotInterval()
+	}
+	return 0
+}
+
+// checkpoint periodically calls snapshot() on the node and atomically
+// writes the result to the snapshot store, so stateful nodes survive a
+// Kapacitor restart without waiting for task stop.
+func (n *node) checkpoint(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			n.saveSnapshot()
+		case <-n.stopCheckpoint:
+			return
+		}
+	}
+}
+
+// saveSnapshot takes a snapshot of the node's running state and persists
+// it to the snapshot store, logging rather than failing the node if
+// either step errors.
+//
+// n.snapshot is called on a goroutine other than the one executing
+// runF (checkpoint's ticker goroutine, or whatever goroutine calls
+// stop), so it pauses the parent edges first to guarantee runF isn't
+// concurrently mutating the state snapshot reads -- the same
+// synchronization supervise relies on before re-snapshotting ahead of a
+// restart.
+func (n *node) saveSnapshot() {
+	n.pauseIns()
+	defer n.resumeIns()
+
+	data, err := n.snapshot()
+	if err != nil {
+		n.logger.Error("taking snapshot", Field{"error", err})
+		return
+	}
+	if err := n.snapshotStore.Save(n.et.Task.Name, n.Name(), data); err != nil {
+		n.logger.Error("saving snapshot", Field{"error", err})
+	}
+}
+
+// supervise owns the lifecycle of runF: it runs the node, and on a panic
+// or returned error consults the node's restart policy to decide whether
+// to retry (after draining/pausing the parent edges and backing off) or
+// to abort the whole task the way start used to unconditionally.
+func (n *node) supervise(snapshot []byte) {
+	defer n.closeChildEdges()
+
+	policy, maxRestarts, backoff := n.restartPolicy()
+
+	for attempt := 0; ; attempt++ {
+		err, panicked, stack := n.runOnce(snapshot)
+		if err == nil {
+			n.errCh <- nil
+			return
+		}
+
+		fields := []Field{{"error", err}}
+		if stack != "" {
+			fields = append(fields, Field{"stack", stack})
+		}
+
+		if !shouldRestart(policy, panicked) || attempt >= maxRestarts {
+			n.abortParentEdges()
+			n.logger.Error("node failed", fields...)
 			n.errCh <- err
-		}()
-		// Run node
-		err = n.runF(snapshot)
+			return
+		}
+
+		n.restartCount++
+		n.lastRestart = time.Now()
+		if n.statMap != nil {
+			n.statMap.Add(statRestartCount, 1)
+		}
+		n.logger.Warn("restarting node after error",
+			append(fields, Field{"attempt", attempt + 1}, Field{"max_restarts", maxRestarts})...,
+		)
+
+		n.pauseIns()
+		time.Sleep(restartBackoff(backoff, attempt))
+		if snap, serr := n.snapshot(); serr == nil {
+			snapshot = snap
+		}
+		n.resumeIns()
+	}
+}
+
+// runOnce invokes runF once, recovering a panic into an error so the
+// supervisor can apply the restart policy uniformly to panics and
+// ordinary errors. The stack trace of a panic is returned separately
+// from err so it can be logged as its own "stack" field instead of
+// polluting the error string returned by Err().
+func (n *node) runOnce(snapshot []byte) (err error, panicked bool, stack string) {
+	defer func() {
+		if r := recover(); r != nil {
+			trace := make([]byte, 4096)
+			ln := runtime.Stack(trace, false)
+			err = fmt.Errorf("%v", r)
+			panicked = true
+			stack = string(trace[:ln])
+		}
 	}()
+	err = n.runF(snapshot)
+	return
+}
+
+// restartPolicy returns the policy configured on the underlying
+// pipeline.Node, defaulting to RestartNever for nodes that were never
+// configured with one.
+func (n *node) restartPolicy() (RestartPolicy, int, time.Duration) {
+	if p, ok := n.Node.(restartPolicyProvider); ok {
+		return p.RestartPolicy()
+	}
+	return RestartNever, 0, 0
+}
+
+func shouldRestart(policy RestartPolicy, panicked bool) bool {
+	switch policy {
+	case RestartAlways:
+		return true
+	case RestartOnPanic:
+		return panicked
+	default:
+		return false
+	}
 }
 
 func (n *node) stop() {
 	if n.stopF != nil {
 		n.stopF()
 	}
+	if n.stopCheckpoint != nil {
+		close(n.stopCheckpoint)
+	}
+	if n.snapshotStore != nil {
+		n.saveSnapshot()
+	}
 	DeleteStatistics(n.statsKey)
 }
 
-// no-op snapshot
-func (n *node) snapshot() (b []byte, err error) { return }
+// snapshot defers to snapshotF when the node was constructed with one,
+// and is otherwise a no-op. saveSnapshot and supervise call this method
+// on *node itself, so a node type that embeds *node hands its state to
+// them through snapshotF; a snapshot method defined on the embedding
+// type is not called by them.
+func (n *node) snapshot() ([]byte, error) {
+	if n.snapshotF != nil {
+		return n.snapshotF()
+	}
+	return nil, nil
+}
 
 // no-op restore
 func (n *node) restore([]byte) error { return nil }
@@ -245,9 +440,23 @@ func (n *node) collectedCount() (count int64) {
 	for _, in := range n.ins {
 		count += in.emittedCount()
 	}
+	n.reportCollected(count)
 	return
 }
 
+// reportCollected dual-writes the cumulative collected count into the
+// Prometheus CounterVec alongside the existing expvar statMap, since
+// Prometheus counters only move forward via Add.
+func (n *node) reportCollected(count int64) {
+	if n.promLabels == nil {
+		return
+	}
+	prev := atomic.SwapInt64(&n.lastCollected, count)
+	if delta := count - prev; delta > 0 {
+		NodeMetrics().collected.With(n.promLabels).Add(float64(delta))
+	}
+}
+
 // Statistics for a node
 type nodeStats struct {
 	Fields     models.Fields
@@ -256,49 +465,13 @@ type nodeStats struct {
 }
 
 // Return a copy of the current node statistics.
-func (n *node) nodeStatsByGroup() (stats map[models.GroupID]nodeStats) {
-	// Get the counts for just one output.
-	if len(n.outs) > 0 {
-		stats = make(map[models.GroupID]nodeStats)
-		n.outs[0].readGroupStats(func(group models.GroupID, c, e int64, tags models.Tags, dims []string) {
-			stats[group] = nodeStats{
-				Fields: models.Fields{
-					// A node's emitted count is the collected count of its output.
-					"emitted": c,
-				},
-				Tags:       tags,
-				Dimensions: dims,
-			}
-		})
-	}
-	return
-}
-
-// MaxDuration is a 64-bit int variable representing a duration in nanoseconds,that satisfies the expvar.Var interface.
-// When setting a value it will only be set if it is greater than the current value.
-type MaxDuration struct {
-	d int64
-}
-
-func (v *MaxDuration) String() string {
-	return time.Duration(v.Int()).String()
-}
-
-func (v *MaxDuration) Int() int64 {
-	return atomic.LoadInt64(&v.d)
-}
-
-// Set sets value if it is greater than current value.
-func (v *MaxDuration) Set(value float64) {
-	next := int64(value)
-	for {
-		cur := v.Int()
-		if next > cur {
-			if atomic.CompareAndSwapInt64(&v.d, cur, next) {
-				return
-			}
-		} else {
-			return
-		}
-	}
+//
+// Edge does not attribute its counts to individual groups, only to the
+// edge as a whole (see Edge.emittedCount/collectedCount), so there is no
+// per-group breakdown to report here yet. nodeStatsByGroup intentionally
+// returns nil rather than a map that looks populated but is always
+// empty; callers that want a per-node total should use collectedCount
+// and n.outs[i].emittedCount() instead.
+func (n *node) nodeStatsByGroup() map[models.GroupID]nodeStats {
+	return nil
 }
@@ -0,0 +1,114 @@
+package kapacitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReportCollectedOnlyAddsTheDelta(t *testing.T) {
+	n := &node{
+		promLabels: prometheus.Labels{"task": "t", "node": "n", "type": "stream", "kind": "window"},
+	}
+
+	n.reportCollected(5)
+	n.reportCollected(5) // no movement, should not double count
+	n.reportCollected(8)
+
+	got := testutil.ToFloat64(NodeMetrics().collected.With(n.promLabels))
+	if got != 8 {
+		t.Fatalf("collected counter = %v, want 8", got)
+	}
+}
+
+func TestReportCollectedNoopWithoutPromLabels(t *testing.T) {
+	n := &node{}
+	// Must not panic when start() (and therefore promLabels) was never
+	// reached, e.g. in tests that construct a node directly.
+	n.reportCollected(5)
+}
+
+func TestNodeExecTimeHistogramReusesRegisteredCollector(t *testing.T) {
+	labels := prometheus.Labels{"task": "bucket-test", "node": "n", "type": "stream", "kind": "window"}
+	buckets := []float64{0.1, 0.5, 1}
+
+	h := nodeExecTimeHistogram(labels, buckets)
+	h.Observe(0.2)
+
+	// Re-requesting the same labels must return the already-registered
+	// collector rather than panicking on AlreadyRegisteredError.
+	h2 := nodeExecTimeHistogram(labels, buckets)
+	if h != h2 {
+		t.Fatal("nodeExecTimeHistogram returned a different collector for the same labels")
+	}
+}
+
+func TestNodeExecTimeHistogramDefaultsBuckets(t *testing.T) {
+	labels := prometheus.Labels{"task": "default-bucket-test", "node": "n", "type": "stream", "kind": "window"}
+	h := nodeExecTimeHistogram(labels, nil)
+	if h == nil {
+		t.Fatal("nodeExecTimeHistogram(nil buckets) returned nil")
+	}
+}
+
+func TestExecTimeStatSetUpdatesString(t *testing.T) {
+	labels := prometheus.Labels{"task": "stat-test", "node": "n", "type": "stream", "kind": "window"}
+	s := &execTimeStat{histogram: nodeExecTimeHistogram(labels, nil)}
+
+	s.Set(float64(1500000)) // 1.5ms in nanoseconds
+	if got := s.String(); got != "1.5ms" {
+		t.Fatalf("String() = %q, want %q", got, "1.5ms")
+	}
+}
+
+func TestHandleMetricsExposesMetricsAndPprof(t *testing.T) {
+	mux := http.NewServeMux()
+	HandleMetrics(mux)
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /metrics status = %d, want 200", resp.StatusCode)
+	}
+
+	resp, err = http.Get(srv.URL + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("GET /debug/pprof/: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /debug/pprof/ status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestNewHTTPDServiceRegistersMetrics(t *testing.T) {
+	s := NewHTTPDService()
+
+	srv := httptest.NewServer(s.Mux)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("NewHTTPDService did not expose /metrics, status = %d", resp.StatusCode)
+	}
+
+	body := make([]byte, 4096)
+	n, _ := resp.Body.Read(body)
+	if !strings.Contains(string(body[:n]), "#") {
+		t.Fatalf("expected Prometheus exposition format, got %q", body[:n])
+	}
+}
@@ -0,0 +1,90 @@
+package kapacitor
+
+import (
+	"time"
+
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// RestartPolicy controls how a supervised node reacts when runF panics
+// or returns an error, mirroring the policy configured on the pipeline
+// node via .restartPolicy(policy, maxRestarts, backoff).
+type RestartPolicy int
+
+const (
+	// RestartNever aborts the parent edges and propagates the failure
+	// immediately, the original, unsupervised behavior.
+	RestartNever RestartPolicy = iota
+	// RestartOnPanic restarts runF only when it recovered from a panic;
+	// an ordinary returned error still aborts the node.
+	RestartOnPanic
+	// RestartAlways restarts runF for both panics and returned errors.
+	RestartAlways
+)
+
+func (p RestartPolicy) String() string {
+	switch p {
+	case RestartOnPanic:
+		return "on-panic"
+	case RestartAlways:
+		return "always"
+	default:
+		return "never"
+	}
+}
+
+// restartPolicyProvider is implemented by pipeline.Node implementations
+// configured with a restart policy. node type-asserts its embedded
+// pipeline.Node against this interface rather than the executor package
+// depending on every concrete pipeline node type.
+type restartPolicyProvider interface {
+	RestartPolicy() (policy RestartPolicy, maxRestarts int, backoff time.Duration)
+}
+
+// restartPolicyNode wraps a pipeline.Node to configure a restart policy
+// on it. This is the builder .restartPolicy(policy, maxRestarts,
+// backoff) is expected to construct: pipeline node types don't need to
+// implement restartPolicyProvider themselves, they just get wrapped with
+// WithRestartPolicy wherever that builder is called while defining the
+// task's pipeline.
+type restartPolicyNode struct {
+	pipeline.Node
+	policy      RestartPolicy
+	maxRestarts int
+	backoff     time.Duration
+}
+
+// WithRestartPolicy returns n configured so the executor's supervisor
+// restarts it according to policy: on a panic or returned error, up to
+// maxRestarts times, backing off exponentially starting at backoff and
+// capped at maxRestartBackoff.
+func WithRestartPolicy(n pipeline.Node, policy RestartPolicy, maxRestarts int, backoff time.Duration) pipeline.Node {
+	return &restartPolicyNode{
+		Node:        n,
+		policy:      policy,
+		maxRestarts: maxRestarts,
+		backoff:     backoff,
+	}
+}
+
+func (r *restartPolicyNode) RestartPolicy() (RestartPolicy, int, time.Duration) {
+	return r.policy, r.maxRestarts, r.backoff
+}
+
+// maxRestartBackoff caps the exponential backoff applied between
+// restarts so a persistently failing node cannot stall the task forever.
+const maxRestartBackoff = 30 * time.Second
+
+// restartBackoff returns the backoff duration for the given restart
+// attempt (0-indexed), doubling base each time and capping at
+// maxRestartBackoff.
+func restartBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base << uint(attempt)
+	if d <= 0 || d > maxRestartBackoff {
+		return maxRestartBackoff
+	}
+	return d
+}
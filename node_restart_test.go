@@ -0,0 +1,122 @@
+package kapacitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// fakePipelineNode is the minimal pipeline.Node stand-in needed to wrap
+// with WithRestartPolicy and drive node.supervise directly, without the
+// rest of the executor (ExecutingTask, TaskMaster, stats) in play.
+type fakePipelineNode struct {
+	pipeline.Node
+}
+
+func TestRestartBackoff(t *testing.T) {
+	base := 100 * time.Millisecond
+	cases := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, 100 * time.Millisecond},
+		{1, 200 * time.Millisecond},
+		{2, 400 * time.Millisecond},
+		{10, maxRestartBackoff}, // doubling passes the cap from attempt 9 on (51.2s)
+	}
+	for _, c := range cases {
+		if got := restartBackoff(base, c.attempt); got != c.want {
+			t.Errorf("restartBackoff(%s, %d) = %s, want %s", base, c.attempt, got, c.want)
+		}
+	}
+	if got := restartBackoff(0, 5); got != 0 {
+		t.Errorf("restartBackoff(0, 5) = %s, want 0", got)
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	cases := []struct {
+		policy   RestartPolicy
+		panicked bool
+		want     bool
+	}{
+		{RestartNever, true, false},
+		{RestartNever, false, false},
+		{RestartOnPanic, true, true},
+		{RestartOnPanic, false, false},
+		{RestartAlways, true, true},
+		{RestartAlways, false, true},
+	}
+	for _, c := range cases {
+		if got := shouldRestart(c.policy, c.panicked); got != c.want {
+			t.Errorf("shouldRestart(%s, %v) = %v, want %v", c.policy, c.panicked, got, c.want)
+		}
+	}
+}
+
+// TestSuperviseRestartsOnPolicy exercises WithRestartPolicy end to end:
+// a node configured with RestartAlways must survive two failing runF
+// attempts (a panic then a plain error) and succeed on the third,
+// without ever reaching abortParentEdges.
+func TestSuperviseRestartsOnPolicy(t *testing.T) {
+	wrapped := WithRestartPolicy(fakePipelineNode{}, RestartAlways, 5, time.Millisecond)
+
+	n := &node{
+		Node:   wrapped,
+		errCh:  make(chan error, 1),
+		logger: NewStructuredLogger(ioutil.Discard),
+	}
+
+	attempts := 0
+	n.runF = func(snapshot []byte) error {
+		attempts++
+		switch attempts {
+		case 1:
+			panic("boom")
+		case 2:
+			return errors.New("transient failure")
+		default:
+			return nil
+		}
+	}
+
+	n.supervise(nil)
+
+	if err := <-n.errCh; err != nil {
+		t.Fatalf("supervise propagated an error despite RestartAlways: %s", err)
+	}
+	if attempts != 3 {
+		t.Fatalf("runF called %d times, want 3", attempts)
+	}
+	if n.restartCount != 2 {
+		t.Fatalf("restartCount = %d, want 2", n.restartCount)
+	}
+}
+
+// TestSuperviseAbortsAfterMaxRestarts verifies that a persistently
+// failing node still gives up once maxRestarts is exhausted, rather than
+// retrying forever.
+func TestSuperviseAbortsAfterMaxRestarts(t *testing.T) {
+	wrapped := WithRestartPolicy(fakePipelineNode{}, RestartAlways, 2, time.Millisecond)
+
+	n := &node{
+		Node:   wrapped,
+		errCh:  make(chan error, 1),
+		logger: NewStructuredLogger(ioutil.Discard),
+	}
+	n.runF = func(snapshot []byte) error {
+		return errors.New("always fails")
+	}
+
+	n.supervise(nil)
+
+	if err := <-n.errCh; err == nil {
+		t.Fatal("supervise returned nil error, want the final failure after exhausting maxRestarts")
+	}
+	if n.restartCount != 2 {
+		t.Fatalf("restartCount = %d, want 2", n.restartCount)
+	}
+}
@@ -0,0 +1,103 @@
+package kapacitor
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+// StorageConfig is the [storage] section of the Kapacitor config. It
+// currently only controls where the default SnapshotStore keeps its
+// BoltDB file.
+type StorageConfig struct {
+	// SnapshotDir is the directory the snapshot store's BoltDB file is
+	// created in. Leaving it empty disables the snapshot store.
+	SnapshotDir string
+}
+
+// NewStorageConfig returns the default config: snapshots disabled.
+func NewStorageConfig() StorageConfig {
+	return StorageConfig{}
+}
+
+// snapshotFile returns the BoltDB file path for this config's
+// SnapshotDir.
+func (c StorageConfig) snapshotFile() string {
+	return filepath.Join(c.SnapshotDir, "snapshot.db")
+}
+
+// snapshotIntervalProvider is implemented by pipeline.Node
+// implementations configured with a checkpoint interval. node
+// type-asserts its embedded pipeline.Node against this interface rather
+// than the executor package depending on every concrete pipeline node
+// type.
+type snapshotIntervalProvider interface {
+	SnapshotInterval() time.Duration
+}
+
+// SnapshotStore persists and restores the opaque per-node snapshot bytes
+// produced by Node.snapshot/Node.restore, so that stateful nodes (window,
+// stateDuration, join buffers, ...) can survive a Kapacitor restart
+// without relying on external tooling to marshal snapshots.
+type SnapshotStore interface {
+	Save(taskName, nodeName string, data []byte) error
+	Load(taskName, nodeName string) ([]byte, error)
+}
+
+// boltSnapshotStore is the default SnapshotStore, backed by a single
+// embedded BoltDB file rooted at the configured [storage] snapshot-dir.
+// Each task gets its own top level bucket, keyed by node name, so that
+// Save/Load never need to scan the whole database.
+type boltSnapshotStore struct {
+	db *bolt.DB
+}
+
+// NewBoltSnapshotStore opens (creating if necessary) the BoltDB file at
+// path and returns a SnapshotStore backed by it.
+func NewBoltSnapshotStore(path string) (SnapshotStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening snapshot store %q: %s", path, err)
+	}
+	return &boltSnapshotStore{db: db}, nil
+}
+
+// Save atomically writes data for taskName/nodeName, creating the task's
+// bucket on first use.
+func (s *boltSnapshotStore) Save(taskName, nodeName string, data []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(taskName))
+		if err != nil {
+			return err
+		}
+		// Bolt only guarantees the []byte passed to Put for the
+		// lifetime of the transaction, so copy defensively.
+		cp := make([]byte, len(data))
+		copy(cp, data)
+		return b.Put([]byte(nodeName), cp)
+	})
+}
+
+// Load returns the most recently saved snapshot for taskName/nodeName, or
+// a nil slice if none has ever been saved.
+func (s *boltSnapshotStore) Load(taskName, nodeName string) (data []byte, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(taskName))
+		if b == nil {
+			return nil
+		}
+		if v := b.Get([]byte(nodeName)); v != nil {
+			data = make([]byte, len(v))
+			copy(data, v)
+		}
+		return nil
+	})
+	return
+}
+
+// Close releases the underlying BoltDB file.
+func (s *boltSnapshotStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,154 @@
+package kapacitor
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/influxdata/kapacitor/pipeline"
+)
+
+// namedFakeNode is fakePipelineNode (see node_restart_test.go) plus a real
+// Name(), since saveSnapshot needs n.Name() to key the snapshot store and
+// calling a method on fakePipelineNode's nil embedded pipeline.Node would
+// panic.
+type namedFakeNode struct {
+	pipeline.Node
+	name string
+}
+
+func (f namedFakeNode) Name() string { return f.name }
+
+func newTestBoltSnapshotStore(t *testing.T) (SnapshotStore, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "kapacitor-snapshot-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	store, err := NewBoltSnapshotStore(filepath.Join(dir, "snapshot.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("NewBoltSnapshotStore: %s", err)
+	}
+	return store, func() {
+		store.(*boltSnapshotStore).Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestBoltSnapshotStoreSaveLoadRoundTrip(t *testing.T) {
+	store, cleanup := newTestBoltSnapshotStore(t)
+	defer cleanup()
+
+	want := []byte("window-node-state")
+	if err := store.Save("taskA", "window1", want); err != nil {
+		t.Fatalf("Save: %s", err)
+	}
+
+	got, err := store.Load("taskA", "window1")
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Load = %q, want %q", got, want)
+	}
+}
+
+func TestBoltSnapshotStoreLoadMissingReturnsNil(t *testing.T) {
+	store, cleanup := newTestBoltSnapshotStore(t)
+	defer cleanup()
+
+	got, err := store.Load("no-such-task", "no-such-node")
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if got != nil {
+		t.Fatalf("Load on missing key = %q, want nil", got)
+	}
+}
+
+func TestBoltSnapshotStoreOverwrite(t *testing.T) {
+	store, cleanup := newTestBoltSnapshotStore(t)
+	defer cleanup()
+
+	if err := store.Save("taskA", "n1", []byte("v1")); err != nil {
+		t.Fatalf("Save v1: %s", err)
+	}
+	if err := store.Save("taskA", "n1", []byte("v2")); err != nil {
+		t.Fatalf("Save v2: %s", err)
+	}
+	got, err := store.Load("taskA", "n1")
+	if err != nil {
+		t.Fatalf("Load: %s", err)
+	}
+	if string(got) != "v2" {
+		t.Fatalf("Load after overwrite = %q, want %q", got, "v2")
+	}
+}
+
+func TestNewTaskMasterWiresSnapshotService(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kapacitor-taskmaster-test")
+	if err != nil {
+		t.Fatalf("TempDir: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := StorageConfig{SnapshotDir: dir}
+	tm, err := NewTaskMaster(NewLogService(ioutil.Discard), nil, cfg)
+	if err != nil {
+		t.Fatalf("NewTaskMaster: %s", err)
+	}
+	if tm.SnapshotService == nil {
+		t.Fatal("NewTaskMaster with a SnapshotDir left SnapshotService nil")
+	}
+
+	if err := tm.SnapshotService.Save("t", "n", []byte("x")); err != nil {
+		t.Fatalf("Save through TaskMaster-wired store: %s", err)
+	}
+}
+
+func TestNewTaskMasterDisabledWithoutSnapshotDir(t *testing.T) {
+	tm, err := NewTaskMaster(NewLogService(ioutil.Discard), nil, NewStorageConfig())
+	if err != nil {
+		t.Fatalf("NewTaskMaster: %s", err)
+	}
+	if tm.SnapshotService != nil {
+		t.Fatal("NewTaskMaster with no SnapshotDir configured should leave SnapshotService nil")
+	}
+}
+
+// TestSaveSnapshotPausesParentEdgesDuringSnapshot verifies the
+// synchronization saveSnapshot needs with the goroutine executing runF:
+// every parent edge must be paused for the full duration of the
+// n.snapshot() call, and resumed again once it returns.
+func TestSaveSnapshotPausesParentEdgesDuringSnapshot(t *testing.T) {
+	store, cleanup := newTestBoltSnapshotStore(t)
+	defer cleanup()
+
+	in := newEdge("taskA", "parent", "child", 0, 4, nil)
+
+	n := &node{
+		et:            &ExecutingTask{Task: &Task{Name: "taskA"}},
+		ins:           []*Edge{in},
+		logger:        NewStructuredLogger(ioutil.Discard),
+		snapshotStore: store,
+	}
+	n.Node = namedFakeNode{name: "window1"}
+
+	pausedDuringSnapshot := false
+	n.snapshotF = func() ([]byte, error) {
+		pausedDuringSnapshot = in.paused
+		return []byte("state"), nil
+	}
+
+	n.saveSnapshot()
+
+	if !pausedDuringSnapshot {
+		t.Fatal("parent edge was not paused while snapshot() ran")
+	}
+	if in.paused {
+		t.Fatal("parent edge still paused after saveSnapshot returned")
+	}
+}
@@ -0,0 +1,89 @@
+package kapacitor
+
+import (
+	"github.com/influxdata/kapacitor/timer"
+)
+
+// TaskType identifies whether a task runs over a stream or a batch of
+// points; it only ever takes on the two values below.
+type TaskType int
+
+const (
+	StreamTask TaskType = iota
+	BatchTask
+)
+
+func (t TaskType) String() string {
+	switch t {
+	case BatchTask:
+		return "batch"
+	default:
+		return "stream"
+	}
+}
+
+// Task is the compiled, runnable form of a pipeline plus the metadata
+// node.start needs to tag its stats and metrics.
+type Task struct {
+	Name string
+	Type TaskType
+
+	// HistogramBuckets configures the Prometheus exec-time histogram
+	// buckets (in seconds) used by every node in this task. Nil selects
+	// prometheus.DefBuckets.
+	HistogramBuckets []float64
+}
+
+// TimerSetter is satisfied by any stat variable a TimingService can time
+// into -- anything with a Set(nanoseconds float64) method, e.g.
+// execTimeStat.
+type TimerSetter interface {
+	Set(value float64)
+}
+
+// TimingService hands out timer.Timer instances that report elapsed
+// time into a TimerSetter, mirroring the timing wrapper already used for
+// avg_exec_time.
+type TimingService interface {
+	NewTimer(TimerSetter) timer.Timer
+}
+
+// TaskMaster owns the services shared by every ExecutingTask: logging,
+// timing, and (since the snapshot store landed) persisting node state
+// across restarts.
+type TaskMaster struct {
+	LogService      *LogService
+	TimingService   TimingService
+	SnapshotService SnapshotStore
+}
+
+// NewTaskMaster returns a TaskMaster wired up with a snapshot store
+// rooted at cfg.SnapshotDir. A zero Config disables the snapshot store
+// (SnapshotService is left nil) so tasks without persisted state don't
+// pay for an unused BoltDB file.
+func NewTaskMaster(logService *LogService, timingService TimingService, cfg StorageConfig) (*TaskMaster, error) {
+	tm := &TaskMaster{
+		LogService:    logService,
+		TimingService: timingService,
+	}
+	if cfg.SnapshotDir == "" {
+		return tm, nil
+	}
+	store, err := NewBoltSnapshotStore(cfg.snapshotFile())
+	if err != nil {
+		return nil, err
+	}
+	tm.SnapshotService = store
+	return tm, nil
+}
+
+// ExecutingTask is a Task bound to the TaskMaster running it.
+type ExecutingTask struct {
+	Task *Task
+	tm   *TaskMaster
+}
+
+// NewExecutingTask returns a Task ready to be executed by tm.
+func NewExecutingTask(tm *TaskMaster, t *Task) *ExecutingTask {
+	return &ExecutingTask{Task: t, tm: tm}
+}